@@ -0,0 +1,178 @@
+package ccache
+
+import (
+	"sync"
+)
+
+// Admission identifies whether new keys must pass an admission filter
+// before being inserted into a full shard.
+type Admission int
+
+const (
+	// AdmissionNone admits every new key unconditionally. This is the default.
+	AdmissionNone Admission = iota
+	// AdmissionTinyLFU gates a new key's insert, once a shard is full, on a
+	// frequency estimate against the item the policy would otherwise evict.
+	AdmissionTinyLFU
+)
+
+// admissionFilter decides whether a new key is worth admitting into a full
+// shard, kept up to date on every access so it can estimate frequency.
+type admissionFilter interface {
+	// RecordAccess bumps key's estimated frequency.
+	RecordAccess(key int64)
+	// Admit decides whether newKey should be allowed to displace victimKey.
+	Admit(newKey, victimKey int64) bool
+}
+
+func newAdmissionFilter(config *ConfigurationInt64, shardMaxSize int64) admissionFilter {
+	switch config.admissionKind {
+	case AdmissionTinyLFU:
+		return newTinyLFU(shardMaxSize)
+	default:
+		return noAdmissionFilter{}
+	}
+}
+
+type noAdmissionFilter struct{}
+
+func (noAdmissionFilter) RecordAccess(key int64)             {}
+func (noAdmissionFilter) Admit(newKey, victimKey int64) bool { return true }
+
+// sketchDepth is the number of independent counter rows in the sketch, i.e.
+// the number of hash functions used per key.
+const sketchDepth = 4
+
+// tinyLFU is a Count-Min Sketch of 4-bit counters, plus a doorkeeper bloom
+// filter that keeps one-hit wonders out of the sketch entirely. See
+// "TinyLFU: A Highly Efficient Cache Admission Policy" (Einziger et al).
+type tinyLFU struct {
+	mu           sync.Mutex
+	width        uint64
+	counters     [][]uint8 // [sketchDepth][width], each cell clamped to 0-15
+	doorkeeper   []uint64  // bitset, 64 keys per word
+	additions    int64
+	maxAdditions int64
+}
+
+func newTinyLFU(maxSize int64) *tinyLFU {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	width := uint64(maxSize) * 8
+	if width < 16 {
+		width = 16
+	}
+	counters := make([][]uint8, sketchDepth)
+	for i := range counters {
+		counters[i] = make([]uint8, width)
+	}
+	return &tinyLFU{
+		width:        width,
+		counters:     counters,
+		doorkeeper:   make([]uint64, (width/64)+1),
+		maxAdditions: maxSize * 10,
+	}
+}
+
+func (t *tinyLFU) RecordAccess(key int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.increment(key)
+}
+
+func (t *tinyLFU) Admit(newKey, victimKey int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.estimate(newKey) > t.estimate(victimKey)
+}
+
+func (t *tinyLFU) increment(key int64) {
+	if !t.doorSet(key) {
+		// First sighting: the doorkeeper remembers it, but it doesn't earn
+		// a place in the sketch until it's seen a second time.
+		return
+	}
+	for row := 0; row < sketchDepth; row++ {
+		idx := t.index(key, row)
+		if t.counters[row][idx] < 15 {
+			t.counters[row][idx]++
+		}
+	}
+	t.additions++
+	if t.additions >= t.maxAdditions {
+		t.age()
+	}
+}
+
+func (t *tinyLFU) estimate(key int64) uint8 {
+	if !t.doorTest(key) {
+		return 0
+	}
+	min := uint8(15)
+	for row := 0; row < sketchDepth; row++ {
+		if v := t.counters[row][t.index(key, row)]; v < min {
+			min = v
+		}
+	}
+	return min + 1
+}
+
+// age halves every counter and clears the doorkeeper so the sketch reflects
+// recent activity instead of saturating over the cache's lifetime.
+func (t *tinyLFU) age() {
+	for _, row := range t.counters {
+		for i := range row {
+			row[i] /= 2
+		}
+	}
+	for i := range t.doorkeeper {
+		t.doorkeeper[i] = 0
+	}
+	t.additions = 0
+}
+
+func (t *tinyLFU) index(key int64, row int) uint64 {
+	h1, h2 := fnvHash(key)
+	return (h1 + uint64(row)*h2) % t.width
+}
+
+func (t *tinyLFU) doorBit(key int64) uint64 {
+	h1, _ := fnvHash(key)
+	return h1 % (uint64(len(t.doorkeeper)) * 64)
+}
+
+// doorTest reports whether key has been seen before.
+func (t *tinyLFU) doorTest(key int64) bool {
+	bit := t.doorBit(key)
+	return t.doorkeeper[bit/64]&(1<<(bit%64)) != 0
+}
+
+// doorSet marks key as seen and reports whether it already had been.
+func (t *tinyLFU) doorSet(key int64) bool {
+	bit := t.doorBit(key)
+	word, mask := bit/64, uint64(1)<<(bit%64)
+	seen := t.doorkeeper[word]&mask != 0
+	t.doorkeeper[word] |= mask
+	return seen
+}
+
+// fnvHash derives two independent hashes of key from distinct FNV-1a seeds;
+// the sketch's depth positions come from these two via double hashing
+// (position_i = h1 + i*h2) instead of sketchDepth separate hash functions.
+func fnvHash(key int64) (uint64, uint64) {
+	const (
+		offset1 = uint64(14695981039346656037)
+		prime1  = uint64(1099511628211)
+		offset2 = uint64(14695981039346656037) ^ 0xa5a5a5a5a5a5a5a5
+		prime2  = uint64(1099511628211)
+	)
+	u := uint64(key)
+	h1, h2 := offset1, offset2
+	for i := 0; i < 8; i++ {
+		b := byte(u >> (8 * uint(i)))
+		h1 = (h1 ^ uint64(b)) * prime1
+		h2 = (h2 ^ uint64(b)) * prime2
+	}
+	return h1, h2
+}
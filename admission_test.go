@@ -0,0 +1,53 @@
+package ccache
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTinyLFUAdmitsHotOverCold fills a one-item shard with a victim, then
+// checks that a never-recorded newcomer is rejected when the victim has been
+// accessed, and that a newcomer recorded as hot beforehand is admitted over
+// an untouched victim.
+func TestTinyLFUAdmitsHotOverCold(t *testing.T) {
+	t.Parallel()
+
+	victimKey := int64(1)
+	newKey := int64(2)
+
+	t.Run("cold newcomer loses to a touched victim", func(t *testing.T) {
+		b := newBucketInt64(ConfigureInt64().MaxSize(1).Admission(AdmissionTinyLFU), 1)
+		defer close(b.promotables)
+
+		b.admission.RecordAccess(victimKey)
+		b.admission.RecordAccess(victimKey)
+		victim := newItemInt64(victimKey, victimKey, time.Now().Add(time.Minute).UnixNano(), false)
+		b.lookup[victimKey] = victim
+		b.size = 1
+		b.policy.Insert(victim)
+
+		newcomer := newItemInt64(newKey, newKey, time.Now().Add(time.Minute).UnixNano(), false)
+		b.lookup[newKey] = newcomer
+		if admitted := b.doPromote(newcomer); admitted {
+			t.Fatalf("expected a never-recorded newcomer to lose to a touched victim")
+		}
+	})
+
+	t.Run("hot newcomer is admitted over an untouched victim", func(t *testing.T) {
+		b := newBucketInt64(ConfigureInt64().MaxSize(1).Admission(AdmissionTinyLFU), 1)
+		defer close(b.promotables)
+
+		victim := newItemInt64(victimKey, victimKey, time.Now().Add(time.Minute).UnixNano(), false)
+		b.lookup[victimKey] = victim
+		b.size = 1
+		b.policy.Insert(victim)
+
+		b.admission.RecordAccess(newKey)
+		b.admission.RecordAccess(newKey)
+		newcomer := newItemInt64(newKey, newKey, time.Now().Add(time.Minute).UnixNano(), false)
+		b.lookup[newKey] = newcomer
+		if admitted := b.doPromote(newcomer); !admitted {
+			t.Fatalf("expected a hot newcomer to be admitted over an untouched victim")
+		}
+	})
+}
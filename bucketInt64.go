@@ -6,9 +6,48 @@ import (
 	"time"
 )
 
+// bucketInt64 is one shard: its own slice of the keyspace, eviction policy,
+// size budget, promote/delete channels and worker goroutine.
 type bucketInt64 struct {
 	sync.RWMutex
-	lookup map[int64]*ItemInt64
+	lookup          map[int64]*ItemInt64
+	policy          evictionPolicy
+	admission       admissionFilter
+	size            int64
+	maxSize         int64
+	itemsToPrune    int
+	tracking        bool
+	onDelete        func(item *ItemInt64)
+	janitorInterval time.Duration
+	deletables      chan *ItemInt64
+	promotables     chan *ItemInt64
+	promoteBatches  chan []*ItemInt64
+	control         chan interface{}
+}
+
+// newBucketInt64 creates a shard with its own eviction policy and worker.
+// maxSize is this shard's slice of the cache's configured max size.
+func newBucketInt64(config *ConfigurationInt64, maxSize int64) *bucketInt64 {
+	b := &bucketInt64{
+		lookup:          make(map[int64]*ItemInt64),
+		policy:          newEvictionPolicy(config),
+		admission:       newAdmissionFilter(config, maxSize),
+		maxSize:         maxSize,
+		itemsToPrune:    config.itemsToPrune,
+		tracking:        config.tracking,
+		onDelete:        config.onDelete,
+		janitorInterval: config.janitorInterval,
+	}
+	b.restart(config)
+	return b
+}
+
+func (b *bucketInt64) restart(config *ConfigurationInt64) {
+	b.deletables = make(chan *ItemInt64, config.deleteBuffer)
+	b.promotables = make(chan *ItemInt64, config.promoteBuffer)
+	b.promoteBatches = make(chan []*ItemInt64, config.promoteBuffer)
+	b.control = make(chan interface{})
+	go b.worker()
 }
 
 func (b *bucketInt64) itemCount() int {
@@ -23,6 +62,30 @@ func (b *bucketInt64) get(key int64) *ItemInt64 {
 	return b.lookup[key]
 }
 
+// getMulti looks up every key under a single RLock instead of one per key.
+func (b *bucketInt64) getMulti(keys []int64) map[int64]*ItemInt64 {
+	items := make(map[int64]*ItemInt64, len(keys))
+	b.RLock()
+	for _, key := range keys {
+		if item, ok := b.lookup[key]; ok {
+			items[key] = item
+		}
+	}
+	b.RUnlock()
+	return items
+}
+
+// setAt is like set but takes an absolute expiry instead of a duration from
+// now. Used by LoadFile to restore a snapshot entry's original expiry.
+func (b *bucketInt64) setAt(key int64, value interface{}, expires int64, track bool) (*ItemInt64, *ItemInt64) {
+	item := newItemInt64(key, value, expires, track)
+	b.Lock()
+	existing := b.lookup[key]
+	b.lookup[key] = item
+	b.Unlock()
+	return item, existing
+}
+
 func (b *bucketInt64) set(key int64, value interface{}, duration time.Duration, track bool) (*ItemInt64, *ItemInt64) {
 	expires := time.Now().Add(duration).UnixNano()
 	item := newItemInt64(key, value, expires, track)
@@ -33,13 +96,12 @@ func (b *bucketInt64) set(key int64, value interface{}, duration time.Duration,
 	return item, existing
 }
 
-
 func (b *bucketInt64) getIncrVal(key int64) (r int64, exis *ItemInt64) {
 	now := time.Now()
 	tm := now.UnixNano()
 	existing := b.get(key)
 	if existing != nil && existing.expires > tm {
-		if v, ok := existing.value.(*int64);ok{
+		if v, ok := existing.value.(*int64); ok {
 			return *v, existing
 		}
 	}
@@ -56,7 +118,7 @@ func (b *bucketInt64) incrNow(key int64, value int64, now time.Time, duration ti
 	defer b.Unlock()
 	existing := b.lookup[key]
 	if existing != nil && existing.expires > tm {
-		if v, ok := existing.value.(*int64);ok{
+		if v, ok := existing.value.(*int64); ok {
 			*v += value
 			return *v, nil, existing
 		}
@@ -73,7 +135,7 @@ func (b *bucketInt64) incrNowPromote(key int64, value int64, now time.Time, dura
 	defer b.Unlock()
 	existing := b.lookup[key]
 	if existing != nil && existing.expires > tm {
-		if v, ok := existing.value.(*int64);ok{
+		if v, ok := existing.value.(*int64); ok {
 			*v += value
 			atomic.StoreInt64(&existing.expires, expires)
 			return *v, nil, existing
@@ -91,19 +153,21 @@ func (b *bucketInt64) delete(key int64) *ItemInt64 {
 	return item
 }
 
-// This is an expensive operation, so we do what we can to optimize it and limit
-// the impact it has on concurrent operations. Specifically, we:
-// 1 - Do an initial iteration to collect matches. This allows us to do the
-//     "expensive" prefix check (on all values) using only a read-lock
-// 2 - Do a second iteration, under write lock, for the matched results to do
-//     the actual deletion
+// deleteIfSame removes key from the map only if it still points at item,
+// so it won't clobber a newer item a concurrent Set raced in under the
+// same key.
+func (b *bucketInt64) deleteIfSame(key int64, item *ItemInt64) {
+	b.Lock()
+	if b.lookup[key] == item {
+		delete(b.lookup, key)
+	}
+	b.Unlock()
+}
 
-// Also, this is the only place where the Bucket is aware of cache detail: the
-// deletables channel. Passing it here lets us avoid iterating over matched items
-// again in the cache. Further, we pass item to deletables BEFORE actually removing
-// the item from the map. I'm pretty sure this is 100% fine, but it is unique.
-// (We do this so that the write to the channel is under the read lock and not the
-// write lock)
+// deleteFunc collects matches under a read lock, then deletes them under a
+// write lock, to keep the matches check off the write lock. Matches are
+// sent to deletables before being removed from the map, so that send can
+// happen under the read lock too.
 func (b *bucketInt64) deleteFunc(matches func(key int64, item *ItemInt64) bool, deletables chan *ItemInt64) int {
 	lookup := b.lookup
 	items := make([]*ItemInt64, 0)
@@ -130,14 +194,156 @@ func (b *bucketInt64) deleteFunc(matches func(key int64, item *ItemInt64) bool,
 	return len(items)
 }
 
-func (b *bucketInt64) deletePrefix(prefix int64, deletables chan *ItemInt64) int {
+func (b *bucketInt64) deletePrefix(prefix int64) int {
 	return b.deleteFunc(func(key int64, item *ItemInt64) bool {
 		return (key & prefix) == prefix
-	}, deletables)
+	}, b.deletables)
 }
 
-func (b *bucketInt64) clear() {
+// sweepExpired queues every expired item in this shard for deletion.
+func (b *bucketInt64) sweepExpired() int {
+	return b.deleteFunc(func(key int64, item *ItemInt64) bool {
+		return item.Expired()
+	}, b.deletables)
+}
+
+func (b *bucketInt64) clearLookup() {
 	b.Lock()
 	b.lookup = make(map[int64]*ItemInt64)
 	b.Unlock()
 }
+
+// promote queues a hit or new insert for this shard's worker, unless the
+// policy handled it entirely inline (SIEVE just flips a bit).
+func (b *bucketInt64) promote(item *ItemInt64) {
+	if !b.policy.OnHit(item) {
+		return
+	}
+	select {
+	case b.promotables <- item:
+	default:
+	}
+}
+
+func (b *bucketInt64) worker() {
+	defer close(b.control)
+	dropped := 0
+
+	var tick <-chan time.Time
+	if b.janitorInterval > 0 {
+		ticker := time.NewTicker(b.janitorInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case item, ok := <-b.promotables:
+			if ok == false {
+				goto drain
+			}
+			if b.doPromote(item) && b.size > b.maxSize {
+				dropped += b.gc()
+			}
+		case items := <-b.promoteBatches:
+			for _, item := range items {
+				if b.doPromote(item) && b.size > b.maxSize {
+					dropped += b.gc()
+				}
+			}
+		case item := <-b.deletables:
+			b.doDelete(item)
+		case <-tick:
+			b.sweepExpired()
+		case control := <-b.control:
+			switch msg := control.(type) {
+			case getDropped:
+				msg.res <- dropped
+				dropped = 0
+			case setMaxSize:
+				b.maxSize = msg.size
+				if b.size > b.maxSize {
+					dropped += b.gc()
+				}
+			case clear:
+				b.clearLookup()
+				b.size = 0
+				b.policy.Clear()
+				msg.done <- struct{}{}
+			}
+		}
+	}
+
+drain:
+	for {
+		select {
+		case item := <-b.deletables:
+			b.doDelete(item)
+		default:
+			close(b.deletables)
+			return
+		}
+	}
+}
+
+func (b *bucketInt64) doDelete(item *ItemInt64) {
+	if atomic.LoadInt32(&item.inPolicy) == 0 {
+		item.promotions = -2
+	} else {
+		b.size -= item.size
+		if b.onDelete != nil {
+			b.onDelete(item)
+		}
+		b.policy.Remove(item)
+		atomic.StoreInt32(&item.inPolicy, 0)
+	}
+}
+
+func (b *bucketInt64) doPromote(item *ItemInt64) bool {
+	//already deleted
+	if item.promotions == -2 {
+		return false
+	}
+	if atomic.LoadInt32(&item.inPolicy) == 1 { //not a new item
+		b.policy.Promote(item)
+		return false
+	}
+
+	// Admission control only applies to genuinely new keys, once the shard
+	// is full.
+	if b.size >= b.maxSize {
+		if victim := b.policy.Peek(); victim != nil && !b.admission.Admit(item.key, victim.key) {
+			// item.key may have already been overwritten by a concurrent
+			// Set; only remove it from the map if it's still this item.
+			b.deleteIfSame(item.key, item)
+			item.promotions = -2
+			return false
+		}
+	}
+
+	b.size += item.size
+	atomic.StoreInt32(&item.inPolicy, 1)
+	b.policy.Insert(item)
+	return true
+}
+
+func (b *bucketInt64) gc() int {
+	dropped := 0
+	for _, item := range b.policy.Evict(b.itemsToPrune) {
+		if b.tracking && atomic.LoadInt32(&item.refCount) != 0 {
+			// can't evict a referenced, tracked item yet; give it back to
+			// the policy and try again next time
+			b.policy.Insert(item)
+			continue
+		}
+		b.delete(item.key)
+		b.size -= item.size
+		if b.onDelete != nil {
+			b.onDelete(item)
+		}
+		dropped += 1
+		item.promotions = -2
+		atomic.StoreInt32(&item.inPolicy, 0)
+	}
+	return dropped
+}
@@ -0,0 +1,29 @@
+package ccache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardedWorkerConcurrentGetSet(t *testing.T) {
+	cache := NewCacheInt64(ConfigureInt64().MaxSize(1000).Buckets(8))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(key int64) {
+			defer wg.Done()
+			cache.Set(key, key, time.Minute)
+			cache.Get(key)
+			cache.Set(key, key*2, time.Minute)
+		}(int64(i))
+	}
+	wg.Wait()
+
+	if count := cache.ItemCount(); count != 50 {
+		t.Fatalf("expected 50 items across shards, got %d", count)
+	}
+
+	cache.Stop()
+}
@@ -2,22 +2,16 @@
 package ccache
 
 import (
-	"container/list"
-	"sync/atomic"
 	"time"
 )
 
-// The cache has a generic 'control' channel that is used to send
-// messages to the worker. These are the messages that can be sent to it
+// CacheInt64 shards its keyspace across buckets (see bucketInt64) and
+// routes each call to the right shard, fanning out and aggregating for
+// whole-cache operations.
 type CacheInt64 struct {
 	*ConfigurationInt64
-	list        *list.List
-	size        int64
-	buckets     []*bucketInt64
-	bucketMask  int64
-	deletables  chan *ItemInt64
-	promotables chan *ItemInt64
-	control     chan interface{}
+	buckets    []*bucketInt64
+	bucketMask int64
 }
 
 // Create a new cache with the specified configuration
@@ -25,18 +19,17 @@ type CacheInt64 struct {
 func NewCacheInt64(config *ConfigurationInt64) *CacheInt64 {
 	bks := NormalTo2N(int64(config.buckets))
 	c := &CacheInt64{
-		list:          list.New(),
 		ConfigurationInt64: config,
-		bucketMask:    int64(bks) - 1,
-		buckets:       make([]*bucketInt64, bks),
-		control:       make(chan interface{}),
+		bucketMask:         int64(bks) - 1,
+		buckets:            make([]*bucketInt64, bks),
+	}
+	shardMaxSize := config.maxSize / int64(bks)
+	if shardMaxSize < 1 {
+		shardMaxSize = 1
 	}
 	for i := 0; i < int(bks); i++ {
-		c.buckets[i] = &bucketInt64{
-			lookup: make(map[int64]*ItemInt64),
-		}
+		c.buckets[i] = newBucketInt64(config, shardMaxSize)
 	}
-	c.restart()
 	return c
 }
 
@@ -51,7 +44,7 @@ func (c *CacheInt64) ItemCount() int {
 func (c *CacheInt64) DeletePrefix(prefix int64) int {
 	count := 0
 	for _, b := range c.buckets {
-		count += b.deletePrefix(prefix, c.deletables)
+		count += b.deletePrefix(prefix)
 	}
 	return count
 }
@@ -60,7 +53,7 @@ func (c *CacheInt64) DeletePrefix(prefix int64) int {
 func (c *CacheInt64) DeleteFunc(matches func(key int64, item *ItemInt64) bool) int {
 	count := 0
 	for _, b := range c.buckets {
-		count += b.deleteFunc(matches, c.deletables)
+		count += b.deleteFunc(matches, b.deletables)
 	}
 	return count
 }
@@ -70,23 +63,27 @@ func (c *CacheInt64) DeleteFunc(matches func(key int64, item *ItemInt64) bool) i
 // is expired and item.TTL() to see how long until the item expires (which
 // will be negative for an already expired item).
 func (c *CacheInt64) Get(key int64) *ItemInt64 {
-	item := c.bucket(key).get(key)
+	b := c.bucket(key)
+	b.admission.RecordAccess(key)
+	item := b.get(key)
 	if item == nil {
 		return nil
 	}
 	if !item.Expired() {
-		c.promote(item)
+		b.promote(item)
 	}
 	return item
 }
 
 func (c *CacheInt64) GetWithNow(key int64, now time.Time) *ItemInt64 {
-	item := c.bucket(key).get(key)
+	b := c.bucket(key)
+	b.admission.RecordAccess(key)
+	item := b.get(key)
 	if item == nil {
 		return nil
 	}
 	if !item.IsExpired(now) {
-		c.promote(item)
+		b.promote(item)
 	}
 	return item
 }
@@ -116,6 +113,48 @@ func (c *CacheInt64) GetItem(key int64) (*ItemInt64) {
 	//return item, true
 }
 
+// Peek returns the item without promoting it: no channel send, no LRU/SIEVE
+// bookkeeping, no refcount change.
+func (c *CacheInt64) Peek(key int64) *ItemInt64 {
+	return c.bucket(key).get(key)
+}
+
+// GetMulti looks up many keys at once, grouping them by bucket so each
+// bucket's RLock is taken once and its hits are promoted with a single
+// channel send instead of once per key.
+func (c *CacheInt64) GetMulti(keys []int64) map[int64]*ItemInt64 {
+	byBucket := make(map[*bucketInt64][]int64, len(c.buckets))
+	for _, key := range keys {
+		b := c.bucket(key)
+		byBucket[b] = append(byBucket[b], key)
+	}
+
+	result := make(map[int64]*ItemInt64, len(keys))
+	for b, bucketKeys := range byBucket {
+		toPromote := make([]*ItemInt64, 0, len(bucketKeys))
+		for _, key := range bucketKeys {
+			b.admission.RecordAccess(key)
+		}
+		for key, item := range b.getMulti(bucketKeys) {
+			result[key] = item
+			if item.Expired() {
+				continue
+			}
+			if b.policy.OnHit(item) {
+				toPromote = append(toPromote, item)
+			}
+		}
+		if len(toPromote) == 0 {
+			continue
+		}
+		select {
+		case b.promoteBatches <- toPromote:
+		default:
+		}
+	}
+	return result
+}
+
 // Used when the cache was created with the Track() configuration option.
 // Avoid otherwise
 func (c *CacheInt64) TrackingGet(key int64) TrackedItem {
@@ -167,9 +206,10 @@ func (c *CacheInt64) Fetch(key int64, duration time.Duration, fetch func() (inte
 
 // Remove the item from the cache, return true if the item was present, false otherwise.
 func (c *CacheInt64) Delete(key int64) bool {
-	item := c.bucket(key).delete(key)
+	b := c.bucket(key)
+	item := b.delete(key)
 	if item != nil {
-		c.deletables <- item
+		b.deletables <- item
 		return true
 	}
 	return false
@@ -177,50 +217,59 @@ func (c *CacheInt64) Delete(key int64) bool {
 
 // Clears the cache
 func (c *CacheInt64) Clear() {
-	done := make(chan struct{})
-	c.control <- clear{done: done}
-	<-done
+	dones := make([]chan struct{}, len(c.buckets))
+	for i, b := range c.buckets {
+		done := make(chan struct{})
+		dones[i] = done
+		b.control <- clear{done: done}
+	}
+	for _, done := range dones {
+		<-done
+	}
 }
 
-// Stops the background worker. Operations performed on the cache after Stop
-// is called are likely to panic
+// Stops every shard's background worker. Operations performed on the cache
+// after Stop is called are likely to panic
 func (c *CacheInt64) Stop() {
-	close(c.promotables)
-	<-c.control
+	for _, b := range c.buckets {
+		close(b.promotables)
+		<-b.control
+	}
 }
 
 // Gets the number of items removed from the cache due to memory pressure since
 // the last time GetDropped was called
 func (c *CacheInt64) GetDropped() int {
-	res := make(chan int)
-	c.control <- getDropped{res: res}
-	return <-res
+	total := 0
+	for _, b := range c.buckets {
+		res := make(chan int)
+		b.control <- getDropped{res: res}
+		total += <-res
+	}
+	return total
 }
 
-// Sets a new max size. That can result in a GC being run if the new maxium size
-// is smaller than the cached size
+// Sets a new max size, split evenly across shards. That can result in a GC
+// being run on any shard that's now over its (possibly smaller) share.
 func (c *CacheInt64) SetMaxSize(size int64) {
-	c.control <- setMaxSize{size}
-}
-
-func (c *CacheInt64) restart() {
-	c.deletables = make(chan *ItemInt64, c.deleteBuffer)
-	c.promotables = make(chan *ItemInt64, c.promoteBuffer)
-	c.control = make(chan interface{})
-	go c.worker()
-}
-
-func (c *CacheInt64) deleteItem(bucket *bucketInt64, item *ItemInt64) {
-	bucket.delete(item.key) //stop other GETs from getting it
-	c.deletables <- item
+	c.maxSize = size
+	shardMaxSize := size / int64(len(c.buckets))
+	if shardMaxSize < 1 {
+		shardMaxSize = 1
+	}
+	for _, b := range c.buckets {
+		b.control <- setMaxSize{shardMaxSize}
+	}
 }
 
 func (c *CacheInt64) set(key int64, value interface{}, duration time.Duration, track bool) *ItemInt64 {
-	item, existing := c.bucket(key).set(key, value, duration, track)
+	b := c.bucket(key)
+	b.admission.RecordAccess(key)
+	item, existing := b.set(key, value, duration, track)
 	if existing != nil {
-		c.deletables <- existing
+		b.deletables <- existing
 	}
-	c.promote(item)
+	b.promote(item)
 	return item
 }
 
@@ -230,19 +279,23 @@ func (c *CacheInt64) GetIncrVal(key int64) ( r int64) {
 }
 //just incr no renew timeout
 func (c *CacheInt64) Incr(key int64, n int64, duration time.Duration) int64 {
-	r, item, _ := c.bucket(key).incr(key, n, duration, false)
+	b := c.bucket(key)
+	b.admission.RecordAccess(key)
+	r, item, _ := b.incr(key, n, duration, false)
 	if item != nil{
-		c.promote(item)
+		b.promote(item)
 	}
 	return r
 }
 //incr and then renew ttl
 func (c *CacheInt64) IncrPromote(key int64, n int64, duration time.Duration) int64 {
-	r, item, exi := c.bucket(key).incr(key, n, duration, false)
+	b := c.bucket(key)
+	b.admission.RecordAccess(key)
+	r, item, exi := b.incr(key, n, duration, false)
 	if item != nil{
-		c.promote(item)
+		b.promote(item)
 	}else if exi != nil{
-		c.promote(exi)
+		b.promote(exi)
 	}
 	return r
 }
@@ -252,117 +305,15 @@ func (c *CacheInt64) bucket(key int64) *bucketInt64 {
 }
 
 func (c *CacheInt64) Promote(item *ItemInt64) {
-	select {
-	case c.promotables <- item:
-	default:
-	}
-
-}
-func (c *CacheInt64) promote(item *ItemInt64) {
-	select {
-	case c.promotables <- item:
-	default:
-	}
-		
-}
-
-func (c *CacheInt64) worker() {
-	defer close(c.control)
-	dropped := 0
-	for {
-		select {
-		case item, ok := <-c.promotables:
-			if ok == false {
-				goto drain
-			}
-			if c.doPromote(item) && c.size > c.maxSize {
-				dropped += c.gc()
-			}
-		case item := <-c.deletables:
-			c.doDelete(item)
-		case control := <-c.control:
-			switch msg := control.(type) {
-			case getDropped:
-				msg.res <- dropped
-				dropped = 0
-			case setMaxSize:
-				c.maxSize = msg.size
-				if c.size > c.maxSize {
-					dropped += c.gc()
-				}
-			case clear:
-				for _, bucket := range c.buckets {
-					bucket.clear()
-				}
-				c.size = 0
-				c.list = list.New()
-				msg.done <- struct{}{}
-			}
-		}
-	}
-
-drain:
-	for {
-		select {
-		case item := <-c.deletables:
-			c.doDelete(item)
-		default:
-			close(c.deletables)
-			return
-		}
-	}
-}
-
-func (c *CacheInt64) doDelete(item *ItemInt64) {
-	if item.element == nil {
-		item.promotions = -2
-	} else {
-		c.size -= item.size
-		if c.onDelete != nil {
-			c.onDelete(item)
-		}
-		c.list.Remove(item.element)
-	}
+	c.bucket(item.key).promote(item)
 }
 
-func (c *CacheInt64) doPromote(item *ItemInt64) bool {
-	//already deleted
-	if item.promotions == -2 {
-		return false
-	}
-	if item.element != nil { //not a new item
-		if item.shouldPromote(c.getsPerPromote) {
-			c.list.MoveToFront(item.element)
-			item.promotions = 0
-		}
-		return false
-	}
-
-	c.size += item.size
-	item.element = c.list.PushFront(item)
-	return true
-}
-
-func (c *CacheInt64) gc() int {
-	dropped := 0
-	element := c.list.Back()
-	for i := 0; i < c.itemsToPrune; i++ {
-		if element == nil {
-			return dropped
-		}
-		prev := element.Prev()
-		item := element.Value.(*ItemInt64)
-		if c.tracking == false || atomic.LoadInt32(&item.refCount) == 0 {
-			c.bucket(item.key).delete(item.key)
-			c.size -= item.size
-			c.list.Remove(element)
-			if c.onDelete != nil {
-				c.onDelete(item)
-			}
-			dropped += 1
-			item.promotions = -2
-		}
-		element = prev
+// DeleteExpired runs the same sweep as each shard's janitor, synchronously,
+// removing every item whose TTL has elapsed.
+func (c *CacheInt64) DeleteExpired() int {
+	count := 0
+	for _, b := range c.buckets {
+		count += b.sweepExpired()
 	}
-	return dropped
+	return count
 }
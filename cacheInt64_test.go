@@ -0,0 +1,45 @@
+package ccache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeekDoesNotPromote(t *testing.T) {
+	cache := NewCacheInt64(ConfigureInt64().MaxSize(1000).Buckets(4).GetsPerPromote(3))
+	defer cache.Stop()
+
+	cache.Set(1, "value", time.Minute)
+	item := cache.Peek(1)
+	if item == nil || item.Value() != "value" {
+		t.Fatalf("expected Peek to return the item, got %v", item)
+	}
+	if item.promotions != 0 {
+		t.Fatalf("expected Peek not to affect promotion state, got %d", item.promotions)
+	}
+}
+
+func TestGetMultiReturnsEveryHitAcrossBuckets(t *testing.T) {
+	cache := NewCacheInt64(ConfigureInt64().MaxSize(1000).Buckets(4))
+	defer cache.Stop()
+
+	want := map[int64]string{}
+	for i := int64(0); i < 10; i++ {
+		val := "v"
+		cache.Set(i, val, time.Minute)
+		want[i] = val
+	}
+
+	got := cache.GetMulti([]int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 99})
+	if len(got) != len(want) {
+		t.Fatalf("expected %d hits, got %d", len(want), len(got))
+	}
+	for key := range want {
+		if _, ok := got[key]; !ok {
+			t.Fatalf("expected key %d in GetMulti result", key)
+		}
+	}
+	if _, ok := got[99]; ok {
+		t.Fatalf("expected a miss for a key that was never set")
+	}
+}
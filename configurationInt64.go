@@ -1,16 +1,37 @@
 package ccache
 
+import (
+	"time"
+)
+
 type ConfigurationInt64 struct {
-	maxSize        int64
-	buckets        int
-	itemsToPrune   int
-	deleteBuffer   int
-	promoteBuffer  int
-	getsPerPromote int32
-	tracking       bool
-	onDelete       func(item *ItemInt64)
+	maxSize         int64
+	buckets         int
+	itemsToPrune    int
+	deleteBuffer    int
+	promoteBuffer   int
+	getsPerPromote  int32
+	tracking        bool
+	janitorInterval time.Duration
+	policyKind      Policy
+	admissionKind   Admission
+	onDelete        func(item *ItemInt64)
 }
 
+// Policy identifies which eviction algorithm a cache uses to pick a victim
+// when it's over its max size.
+type Policy int
+
+const (
+	// PolicyLRU evicts the least-recently-used item. This is the default.
+	PolicyLRU Policy = iota
+	// PolicySieve uses the SIEVE algorithm: a single FIFO queue plus a
+	// per-item visited bit. A hit only flips the bit instead of moving the
+	// item within a list, which removes the promotion cost (and the
+	// getsPerPromote heuristic) entirely.
+	PolicySieve
+)
+
 // Creates a configuration object with sensible defaults
 // Use this as the start of the fluent configuration:
 // e.g.: ccache.New(ccache.Configure().MaxSize(10000))
@@ -94,6 +115,37 @@ func (c *ConfigurationInt64) Track() *ConfigurationInt64 {
 	return c
 }
 
+// Runs a background sweep, on the given interval, that removes expired items
+// from the cache even if they're never Get/Set again. Without a janitor,
+// expired items only leave the cache via explicit Delete or size-pressure
+// eviction, and can otherwise linger indefinitely.
+// A zero interval (the default) disables the janitor.
+// [0]
+func (c *ConfigurationInt64) Janitor(interval time.Duration) *ConfigurationInt64 {
+	c.janitorInterval = interval
+	return c
+}
+
+// Selects the eviction policy used to pick a victim when the cache is over
+// its max size. PolicySieve trades a bit of recency accuracy for much
+// cheaper Gets under heavy concurrency; see PolicySieve's comment.
+// [PolicyLRU]
+func (c *ConfigurationInt64) Policy(policy Policy) *ConfigurationInt64 {
+	c.policyKind = policy
+	return c
+}
+
+// Selects an admission filter that new keys must pass, once a shard is
+// full, before they're allowed to take a slot. AdmissionTinyLFU weighs a
+// newcomer's estimated frequency against the item that would otherwise be
+// evicted, which protects hot items from being flushed out by a scan or a
+// burst of one-off keys.
+// [AdmissionNone]
+func (c *ConfigurationInt64) Admission(admission Admission) *ConfigurationInt64 {
+	c.admissionKind = admission
+	return c
+}
+
 // OnDelete allows setting a callback function to react to ideam deletion.
 // This typically allows to do a cleanup of resources, such as calling a Close() on
 // cached object that require some kind of tear-down.
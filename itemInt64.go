@@ -17,6 +17,14 @@ type ItemInt64 struct {
 	size       int64
 	value      interface{}
 	element    *list.Element
+	// inPolicy is 1 once the item has been handed to the eviction policy
+	// (inserted into its list). Read/written with atomics since OnHit can
+	// check it from any caller goroutine, not just the worker. Unrelated to
+	// refCount/tracking/Track() -- this is bookkeeping for the eviction
+	// policy, not the caller-held-reference feature.
+	inPolicy int32
+	// visited is the SIEVE "second chance" bit; unused by the LRU policy.
+	visited int32
 }
 
 func newItemInt64(key int64, value interface{}, expires int64, track bool) *ItemInt64 {
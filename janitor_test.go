@@ -0,0 +1,24 @@
+package ccache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeleteExpiredSweepsOnlyExpiredItems(t *testing.T) {
+	cache := NewCacheInt64(ConfigureInt64().MaxSize(1000).Buckets(4))
+	defer cache.Stop()
+
+	cache.Set(1, "stale", -time.Minute)
+	cache.Set(2, "fresh", time.Minute)
+
+	if count := cache.DeleteExpired(); count != 1 {
+		t.Fatalf("expected 1 expired item swept, got %d", count)
+	}
+	if cache.ItemCount() != 1 {
+		t.Fatalf("expected the fresh item to remain, got %d items", cache.ItemCount())
+	}
+	if item := cache.GetItem(2); item == nil {
+		t.Fatalf("expected the fresh item to still be present")
+	}
+}
@@ -0,0 +1,207 @@
+package ccache
+
+import (
+	"container/list"
+	"sync/atomic"
+)
+
+// evictionPolicy decides which item to give up under size pressure, and how
+// a hit/insert/delete affects the structure it uses to make that decision.
+type evictionPolicy interface {
+	// Insert adds a newly-created item. Only called from the worker goroutine.
+	Insert(item *ItemInt64)
+	// OnHit is called synchronously from Get/promote, from any goroutine. It
+	// returns true if the item still needs queuing on promotables for the
+	// worker to finish (e.g. an LRU list move), false if handled inline.
+	OnHit(item *ItemInt64) bool
+	// Promote is called from the worker goroutine for items OnHit flagged.
+	Promote(item *ItemInt64)
+	// Remove detaches an item from the policy, e.g. because it was deleted.
+	Remove(item *ItemInt64)
+	// Evict picks up to n victims, removes them and returns them so the
+	// caller can decide whether to actually drop them.
+	Evict(n int) []*ItemInt64
+	// Peek returns the next eviction victim without removing it, or nil if
+	// the policy is empty. Used by the admission filter.
+	Peek() *ItemInt64
+	// Clear resets the policy to an empty state.
+	Clear()
+}
+
+func newEvictionPolicy(config *ConfigurationInt64) evictionPolicy {
+	switch config.policyKind {
+	case PolicySieve:
+		return newSievePolicy()
+	default:
+		return newLRUPolicy(config.getsPerPromote)
+	}
+}
+
+// lruPolicy is the original container/list-backed least-recently-used
+// policy: every getsPerPromote-th hit moves the item to the front, and
+// eviction takes from the back.
+type lruPolicy struct {
+	list           *list.List
+	getsPerPromote int32
+}
+
+func newLRUPolicy(getsPerPromote int32) *lruPolicy {
+	return &lruPolicy{
+		list:           list.New(),
+		getsPerPromote: getsPerPromote,
+	}
+}
+
+func (p *lruPolicy) Insert(item *ItemInt64) {
+	item.element = p.list.PushFront(item)
+}
+
+// Every hit, LRU or not, needs to (possibly) move the item within the list,
+// so it always has to go through the worker goroutine.
+func (p *lruPolicy) OnHit(item *ItemInt64) bool {
+	return true
+}
+
+func (p *lruPolicy) Promote(item *ItemInt64) {
+	if item.shouldPromote(p.getsPerPromote) {
+		p.list.MoveToFront(item.element)
+		item.promotions = 0
+	}
+}
+
+func (p *lruPolicy) Remove(item *ItemInt64) {
+	if item.element == nil {
+		return
+	}
+	p.list.Remove(item.element)
+	item.element = nil
+}
+
+func (p *lruPolicy) Evict(n int) []*ItemInt64 {
+	victims := make([]*ItemInt64, 0, n)
+	element := p.list.Back()
+	for i := 0; i < n && element != nil; i++ {
+		prev := element.Prev()
+		victim := element.Value.(*ItemInt64)
+		p.list.Remove(element)
+		victim.element = nil
+		victims = append(victims, victim)
+		element = prev
+	}
+	return victims
+}
+
+func (p *lruPolicy) Peek() *ItemInt64 {
+	element := p.list.Back()
+	if element == nil {
+		return nil
+	}
+	return element.Value.(*ItemInt64)
+}
+
+func (p *lruPolicy) Clear() {
+	p.list = list.New()
+}
+
+// sievePolicy implements SIEVE: a single FIFO queue plus a per-item visited
+// bit. Hits only flip the bit, so OnHit never needs the worker goroutine.
+// Eviction walks a "hand" pointer from the tail toward the head, giving a
+// visited item a second chance (clear the bit, advance) and evicting the
+// first unvisited item it finds.
+type sievePolicy struct {
+	list *list.List
+	hand *list.Element
+}
+
+func newSievePolicy() *sievePolicy {
+	return &sievePolicy{list: list.New()}
+}
+
+func (p *sievePolicy) Insert(item *ItemInt64) {
+	item.element = p.list.PushFront(item)
+}
+
+func (p *sievePolicy) OnHit(item *ItemInt64) bool {
+	if atomic.LoadInt32(&item.inPolicy) == 0 {
+		// brand new item: it still needs to be inserted into the FIFO queue
+		// on the worker goroutine.
+		return true
+	}
+	atomic.StoreInt32(&item.visited, 1)
+	return false
+}
+
+// Promote only runs for brand new items OnHit couldn't handle inline;
+// existing items never reach here since OnHit handles their hit itself.
+func (p *sievePolicy) Promote(item *ItemInt64) {
+	atomic.StoreInt32(&item.visited, 1)
+}
+
+func (p *sievePolicy) Remove(item *ItemInt64) {
+	if item.element == nil {
+		return
+	}
+	if p.hand == item.element {
+		p.hand = p.hand.Prev()
+	}
+	p.list.Remove(item.element)
+	item.element = nil
+}
+
+func (p *sievePolicy) Evict(n int) []*ItemInt64 {
+	victims := make([]*ItemInt64, 0, n)
+	for i := 0; i < n; i++ {
+		victim := p.evictOne()
+		if victim == nil {
+			break
+		}
+		victims = append(victims, victim)
+	}
+	return victims
+}
+
+func (p *sievePolicy) evictOne() *ItemInt64 {
+	if p.list.Len() == 0 {
+		return nil
+	}
+	if p.hand == nil {
+		p.hand = p.list.Back()
+	}
+	for {
+		item := p.hand.Value.(*ItemInt64)
+		if atomic.LoadInt32(&item.visited) == 1 {
+			atomic.StoreInt32(&item.visited, 0)
+			p.hand = p.hand.Prev()
+			if p.hand == nil {
+				p.hand = p.list.Back()
+			}
+			continue
+		}
+
+		victim, evicted := p.hand, p.hand.Prev()
+		p.list.Remove(victim)
+		item.element = nil
+		if evicted == nil {
+			p.hand = p.list.Back()
+		} else {
+			p.hand = evicted
+		}
+		return item
+	}
+}
+
+// Peek approximates the next eviction victim as the FIFO tail, rather than
+// running the hand-walk. Good enough for an admission filter's rough
+// "what's cold" comparison.
+func (p *sievePolicy) Peek() *ItemInt64 {
+	element := p.list.Back()
+	if element == nil {
+		return nil
+	}
+	return element.Value.(*ItemInt64)
+}
+
+func (p *sievePolicy) Clear() {
+	p.list = list.New()
+	p.hand = nil
+}
@@ -0,0 +1,56 @@
+package ccache
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestItem(key int64) *ItemInt64 {
+	return newItemInt64(key, key, time.Now().Add(time.Minute).UnixNano(), false)
+}
+
+func TestSievePolicyEvictEmpty(t *testing.T) {
+	p := newSievePolicy()
+	if victims := p.Evict(5); len(victims) != 0 {
+		t.Fatalf("expected no victims from an empty policy, got %d", len(victims))
+	}
+}
+
+func TestSievePolicyEvictSingleItem(t *testing.T) {
+	p := newSievePolicy()
+	item := newTestItem(1)
+	p.Insert(item)
+
+	victims := p.Evict(5)
+	if len(victims) != 1 || victims[0] != item {
+		t.Fatalf("expected to evict the only item, got %v", victims)
+	}
+	if p.list.Len() != 0 {
+		t.Fatalf("expected the list to be empty after evicting its only item")
+	}
+	if victims := p.Evict(1); len(victims) != 0 {
+		t.Fatalf("expected no victims left to evict, got %d", len(victims))
+	}
+}
+
+func TestSievePolicyRemoveHandElement(t *testing.T) {
+	p := newSievePolicy()
+	a, b, c := newTestItem(1), newTestItem(2), newTestItem(3)
+	p.Insert(a)
+	p.Insert(b)
+	p.Insert(c)
+
+	// force the hand onto b, then remove b out from under it
+	p.hand = b.element
+	removed := b.element
+	p.Remove(b)
+
+	if p.hand == removed {
+		t.Fatalf("hand should have moved off the removed element")
+	}
+
+	victims := p.Evict(3)
+	if len(victims) != 2 {
+		t.Fatalf("expected the 2 remaining items, got %d", len(victims))
+	}
+}
@@ -0,0 +1,134 @@
+package ccache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"os"
+	"time"
+)
+
+// Marshaler lets a cached value control its own on-disk representation when
+// the cache is persisted with SaveFile. Values that don't implement it are
+// gob-encoded as-is, which requires their concrete type to be registered
+// with gob.Register.
+type Marshaler interface {
+	MarshalCache() ([]byte, error)
+}
+
+// snapshotEntry is the on-disk record written by SaveFile and read back by
+// LoadFile, one per cached item.
+type snapshotEntry struct {
+	Key     int64
+	Expires int64
+	Size    int64
+	Value   []byte
+}
+
+// SaveFile writes every non-expired item to path, one gob-encoded entry at
+// a time, so the whole cache never needs to be held in memory at once. An
+// item whose value can't be serialized is silently skipped.
+func (c *CacheInt64) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := gob.NewEncoder(f)
+	for _, b := range c.buckets {
+		if err := b.save(enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bucketInt64) save(enc *gob.Encoder) error {
+	b.RLock()
+	defer b.RUnlock()
+
+	for key, item := range b.lookup {
+		if item.Expired() {
+			continue
+		}
+		value, ok := marshalValue(item.value)
+		if !ok {
+			continue
+		}
+		entry := snapshotEntry{
+			Key:     key,
+			Expires: item.expires,
+			Size:    item.size,
+			Value:   value,
+		}
+		if err := enc.Encode(&entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func marshalValue(value interface{}) ([]byte, bool) {
+	if m, ok := value.(Marshaler); ok {
+		data, err := m.MarshalCache()
+		if err != nil {
+			return nil, false
+		}
+		return data, true
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// LoadFile reads a snapshot written by SaveFile and replays each entry
+// through the cache's normal set path, so LRU/SIEVE state ends up the same
+// as it would from live traffic. decoder is the inverse of whatever
+// produced an entry's value bytes (Marshaler.MarshalCache or gob). Entries
+// that have expired since the snapshot was taken are skipped.
+func (c *CacheInt64) LoadFile(path string, decoder func([]byte) (interface{}, error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	now := time.Now().UnixNano()
+	for {
+		var entry snapshotEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if entry.Expires <= now {
+			continue
+		}
+		value, err := decoder(entry.Value)
+		if err != nil {
+			return err
+		}
+		c.restoreAt(entry.Key, value, entry.Expires, entry.Size)
+	}
+}
+
+func (c *CacheInt64) restoreAt(key int64, value interface{}, expires int64, size int64) *ItemInt64 {
+	b := c.bucket(key)
+	b.admission.RecordAccess(key)
+	item, existing := b.setAt(key, value, expires, false)
+	if size > 0 {
+		item.size = size
+	}
+	if existing != nil {
+		b.deletables <- existing
+	}
+	b.promote(item)
+	return item
+}
@@ -0,0 +1,51 @@
+package ccache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	gob.Register(int64(0))
+}
+
+func TestSaveFileLoadFileRoundTrip(t *testing.T) {
+	cache := NewCacheInt64(ConfigureInt64().MaxSize(1000).Buckets(4))
+	for i := int64(0); i < 20; i++ {
+		cache.Set(i, i*10, time.Minute)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot")
+	if err := cache.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile: %v", err)
+	}
+	cache.Stop()
+
+	restored := NewCacheInt64(ConfigureInt64().MaxSize(1000).Buckets(4))
+	decoder := func(data []byte) (interface{}, error) {
+		var v interface{}
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+		return v, err
+	}
+	if err := restored.LoadFile(path, decoder); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	defer restored.Stop()
+
+	if count := restored.ItemCount(); count != 20 {
+		t.Fatalf("expected 20 restored items, got %d", count)
+	}
+	for i := int64(0); i < 20; i++ {
+		item := restored.GetItem(i)
+		if item == nil {
+			t.Fatalf("key %d missing after restore", i)
+		}
+		if v, ok := item.Value().(int64); !ok || v != i*10 {
+			t.Fatalf("key %d: expected value %d, got %v", i, i*10, item.Value())
+		}
+	}
+}